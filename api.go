@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// reportAggregate is the per-group statistics returned by the JSON API.
+type reportAggregate struct {
+	Group       string  `json:"group"`
+	Count       int     `json:"count"`
+	MeanSeconds float64 `json:"mean_seconds"`
+	P50Seconds  float64 `json:"p50_seconds"`
+	P90Seconds  float64 `json:"p90_seconds"`
+	P95Seconds  float64 `json:"p95_seconds"`
+	P99Seconds  float64 `json:"p99_seconds"`
+	MinSeconds  float64 `json:"min_seconds"`
+	MaxSeconds  float64 `json:"max_seconds"`
+	SuccessRate float64 `json:"success_rate"`
+}
+
+// reportAPI serves /api/v1/reports/{name}, a JSON equivalent of the HTML
+// views for scripting/chatops/alerting.
+type reportAPI struct {
+	builds  func(context.Context, time.Time) ([]Build, error)
+	store   *queryStore
+	history time.Duration
+}
+
+func newReportAPI(bk *NetworkBuildkite, store *queryStore, history time.Duration) *reportAPI {
+	return &reportAPI{builds: bk.Builds, store: store, history: history}
+}
+
+func (a *reportAPI) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/{name}", a.getReport)
+	return r
+}
+
+// getReport computes aggregates for one named report over the window
+// selected by ?since=<duration>&until=<RFC3339>, defaulting to the
+// server's scrape-history ending now. Percentiles are computed by sorting
+// the durations and indexing into them, which is O(n log n) per request;
+// fine at current build volumes, but would need replacing with a
+// streaming quantile sketch if that ever becomes the bottleneck.
+func (a *reportAPI) getReport(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	var query *Query
+	for _, q := range a.store.Get() {
+		if q.Name == name {
+			q := q
+			query = &q
+			break
+		}
+	}
+	if query == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	since := a.history
+	if s := r.URL.Query().Get("since"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = d
+	}
+
+	until := time.Now()
+	if u := r.URL.Query().Get("until"); u != "" {
+		t, err := time.Parse(time.RFC3339, u)
+		if err != nil {
+			http.Error(w, "invalid until: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		until = t
+	}
+
+	from := until.Add(-since)
+
+	builds, err := a.builds(r.Context(), from)
+	if err != nil {
+		http.Error(w, "unable to load builds: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Bound both ends of the window using the report's own from/to
+	// timestamps (the same ones Query.Duration/Group use), not a
+	// hardcoded field: a report configured with "to": "started" must be
+	// bounded by when builds started, not when they finished, and
+	// likewise for "from".
+	groups := map[string][]Build{}
+	for _, b := range builds {
+		if !query.Predicate(b) {
+			continue
+		}
+		if query.to.Extract(b).After(until) || query.from.Extract(b).Before(from) {
+			continue
+		}
+		group := query.Group(b)
+		groups[group] = append(groups[group], b)
+	}
+
+	res := make([]reportAggregate, 0, len(groups))
+	for group, gb := range groups {
+		res = append(res, aggregateGroup(group, *query, gb))
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Group < res[j].Group })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func aggregateGroup(group string, q Query, builds []Build) reportAggregate {
+	durations := make([]float64, len(builds))
+	var sum float64
+	var successes int
+	for i, b := range builds {
+		d := q.Duration(b).Seconds()
+		durations[i] = d
+		sum += d
+		if b.State == "passed" {
+			successes++
+		}
+	}
+	sort.Float64s(durations)
+
+	return reportAggregate{
+		Group:       group,
+		Count:       len(durations),
+		MeanSeconds: sum / float64(len(durations)),
+		P50Seconds:  percentile(durations, 0.50),
+		P90Seconds:  percentile(durations, 0.90),
+		P95Seconds:  percentile(durations, 0.95),
+		P99Seconds:  percentile(durations, 0.99),
+		MinSeconds:  durations[0],
+		MaxSeconds:  durations[len(durations)-1],
+		SuccessRate: float64(successes) / float64(len(durations)),
+	}
+}
+
+// percentile indexes into pre-sorted durations; callers must not pass an
+// empty slice.
+func percentile(sorted []float64, p float64) float64 {
+	idx := int(p * float64(len(sorted)-1))
+	return sorted[idx]
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	cases := []struct {
+		p    float64
+		want float64
+	}{
+		{0, 1},
+		{0.5, 5},
+		{1, 10},
+	}
+
+	for _, c := range cases {
+		if got := percentile(sorted, c.p); got != c.want {
+			t.Errorf("percentile(sorted, %v) = %v, want %v", c.p, got, c.want)
+		}
+	}
+}
+
+func TestAggregateGroup(t *testing.T) {
+	q := Query{from: StartedTimestamp, to: FinishedTimestamp}
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	builds := []Build{
+		{ID: "1", StartedAt: base, FinishedAt: base.Add(10 * time.Second), State: "passed"},
+		{ID: "2", StartedAt: base, FinishedAt: base.Add(20 * time.Second), State: "passed"},
+		{ID: "3", StartedAt: base, FinishedAt: base.Add(30 * time.Second), State: "failed"},
+	}
+
+	agg := aggregateGroup("mygroup", q, builds)
+
+	if agg.Group != "mygroup" {
+		t.Errorf("Group = %q, want %q", agg.Group, "mygroup")
+	}
+	if agg.Count != 3 {
+		t.Errorf("Count = %d, want 3", agg.Count)
+	}
+	if agg.MinSeconds != 10 {
+		t.Errorf("MinSeconds = %v, want 10", agg.MinSeconds)
+	}
+	if agg.MaxSeconds != 30 {
+		t.Errorf("MaxSeconds = %v, want 30", agg.MaxSeconds)
+	}
+	if want := (10.0 + 20.0 + 30.0) / 3; agg.MeanSeconds != want {
+		t.Errorf("MeanSeconds = %v, want %v", agg.MeanSeconds, want)
+	}
+	if want := 20.0; agg.P50Seconds != want {
+		t.Errorf("P50Seconds = %v, want %v", agg.P50Seconds, want)
+	}
+	if want := 2.0 / 3; agg.SuccessRate != want {
+		t.Errorf("SuccessRate = %v, want %v", agg.SuccessRate, want)
+	}
+}
+
+func TestAggregateGroupSingleBuild(t *testing.T) {
+	q := Query{from: CreatedTimestamp, to: FinishedTimestamp}
+	builds := []Build{
+		{ID: "1", CreatedAt: time.Time{}, FinishedAt: time.Time{}.Add(5 * time.Second), State: "canceled"},
+	}
+
+	agg := aggregateGroup("only", q, builds)
+
+	if agg.Count != 1 || agg.MinSeconds != 5 || agg.MaxSeconds != 5 || agg.SuccessRate != 0 {
+		t.Errorf("unexpected aggregate for a single non-passed build: %+v", agg)
+	}
+}
+
+// newTestReportAPI builds a reportAPI with a fake builds func, bypassing
+// newReportAPI (which requires a real *NetworkBuildkite).
+func newTestReportAPI(builds []Build, store *queryStore, history time.Duration) *reportAPI {
+	return &reportAPI{
+		builds: func(ctx context.Context, from time.Time) ([]Build, error) {
+			return builds, nil
+		},
+		store:   store,
+		history: history,
+	}
+}
+
+// TestGetReportUsesQueryTimestampsNotHardcodedFields is a regression test
+// for the bug fixed in cf42b1f: filtering must use the report's own
+// from/to fields, not a hardcoded CreatedAt/FinishedAt.
+func TestGetReportUsesQueryTimestampsNotHardcodedFields(t *testing.T) {
+	q := Query{
+		Name:      "slow-master",
+		from:      StartedTimestamp,
+		to:        StartedTimestamp, // deliberately not "finished"
+		pipelines: regexp.MustCompile(".*"),
+		branches:  regexp.MustCompile(".*"),
+		group:     template.Must(template.New("g").Parse("all")),
+	}
+	store := newQueryStore([]Query{q})
+
+	until := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	since := time.Hour
+
+	builds := []Build{
+		// started within the window (and before `until`), finishes well
+		// after `until` -> must be INCLUDED because `to` names "started".
+		{ID: "in-window", StartedAt: until.Add(-30 * time.Minute), FinishedAt: until.Add(48 * time.Hour), State: "passed"},
+		// started after `until` -> must be EXCLUDED, even though it
+		// finishes before `until`.
+		{ID: "started-too-late", StartedAt: until.Add(30 * time.Minute), FinishedAt: until.Add(-48 * time.Hour), State: "passed"},
+		// started before the `since` window opens -> must be EXCLUDED,
+		// the symmetric case for the "from" bound.
+		{ID: "started-too-early", StartedAt: until.Add(-since).Add(-time.Minute), FinishedAt: until, State: "passed"},
+	}
+
+	api := newTestReportAPI(builds, store, 24*time.Hour)
+
+	req := httptest.NewRequest("GET", "/slow-master?since="+since.String()+"&until="+until.Format(time.RFC3339), nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("name", "slow-master")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	api.getReport(w, req)
+
+	var got []reportAggregate
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode response: %v (body: %s)", err, w.Body.String())
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("got %d groups, want 1: %+v", len(got), got)
+	}
+	if got[0].Count != 1 {
+		t.Errorf("Count = %d, want 1 (only the in-window build should be counted)", got[0].Count)
+	}
+}
+
+func TestGetReportUnknownName(t *testing.T) {
+	store := newQueryStore(nil)
+	api := newTestReportAPI(nil, store, time.Hour)
+
+	req := httptest.NewRequest("GET", "/nope", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("name", "nope")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	api.getReport(w, req)
+
+	if w.Code != 404 {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
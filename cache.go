@@ -0,0 +1,223 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/go-redis/redis"
+)
+
+// Cache is the storage backend used to persist scraped build data between
+// refreshes.
+type Cache interface {
+	Put(k string, v []byte, ttl time.Duration) error
+	Get(k string) ([]byte, error)
+}
+
+// ErrCacheMiss is returned by Get when a key isn't present, regardless of
+// backend. Callers should compare against this rather than a
+// backend-specific sentinel.
+var ErrCacheMiss = errors.New("cache: miss")
+
+// newCache builds a Cache from one or more --cache URLs. Supported schemes
+// are memcache://host:port (one or more, pooled as a single client),
+// redis://host:port/db and memory://?size=N.
+func newCache(urls []string) (Cache, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no --cache URL given")
+	}
+
+	scheme, err := cacheScheme(urls)
+	if err != nil {
+		return nil, err
+	}
+
+	switch scheme {
+	case "memcache":
+		return newMemcacheCache(urls)
+	case "redis":
+		if len(urls) > 1 {
+			return nil, fmt.Errorf("--cache redis:// accepts exactly one URL, got %d", len(urls))
+		}
+		return newRedisCache(urls[0])
+	case "memory":
+		if len(urls) > 1 {
+			return nil, fmt.Errorf("--cache memory:// accepts exactly one URL, got %d", len(urls))
+		}
+		return newMemoryCache(urls[0])
+	default:
+		return nil, fmt.Errorf("unrecognised --cache scheme %q", scheme)
+	}
+}
+
+func cacheScheme(urls []string) (string, error) {
+	first, err := url.Parse(urls[0])
+	if err != nil {
+		return "", fmt.Errorf("parsing --cache URL %q: %w", urls[0], err)
+	}
+
+	for _, raw := range urls[1:] {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", fmt.Errorf("parsing --cache URL %q: %w", raw, err)
+		}
+		if u.Scheme != first.Scheme {
+			return "", fmt.Errorf("--cache URLs must share a scheme, got %q and %q", first.Scheme, u.Scheme)
+		}
+	}
+
+	return first.Scheme, nil
+}
+
+// MemcacheCache stores data in one or more Memcache brokers.
+type MemcacheCache struct {
+	c *memcache.Client
+}
+
+func newMemcacheCache(urls []string) (*MemcacheCache, error) {
+	addrs := make([]string, len(urls))
+	for i, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parsing memcache URL %q: %w", raw, err)
+		}
+		addrs[i] = u.Host
+	}
+	return &MemcacheCache{memcache.New(addrs...)}, nil
+}
+
+func (m *MemcacheCache) Put(k string, v []byte, ttl time.Duration) error {
+	return m.c.Set(&memcache.Item{
+		Key:        k,
+		Value:      v,
+		Expiration: int32(time.Now().Add(ttl).Unix()),
+	})
+}
+
+func (m *MemcacheCache) Get(k string) ([]byte, error) {
+	item, err := m.c.Get(k)
+	if err == memcache.ErrCacheMiss {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+// RedisCache stores data in a single Redis database, addressed as
+// redis://host:port/db.
+type RedisCache struct {
+	c *redis.Client
+}
+
+func newRedisCache(rawurl string) (*RedisCache, error) {
+	opts, err := redis.ParseURL(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redis URL: %w", err)
+	}
+	return &RedisCache{redis.NewClient(opts)}, nil
+}
+
+func (r *RedisCache) Put(k string, v []byte, ttl time.Duration) error {
+	return r.c.Set(k, v, ttl).Err()
+}
+
+func (r *RedisCache) Get(k string) ([]byte, error) {
+	v, err := r.c.Get(k).Bytes()
+	if err == redis.Nil {
+		return nil, ErrCacheMiss
+	}
+	return v, err
+}
+
+// MemoryCache is a bounded, in-process LRU cache with per-entry TTLs. It
+// needs no external dependency, so it's the right default for single-binary
+// deployments.
+type MemoryCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func newMemoryCache(rawurl string) (*MemoryCache, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("parsing memory cache URL: %w", err)
+	}
+
+	size := 1000
+	if s := u.Query().Get("size"); s != "" {
+		size, err = strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("parsing memory cache size: %w", err)
+		}
+	}
+
+	return &MemoryCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}, nil
+}
+
+func (m *MemoryCache) Put(k string, v []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := &memoryCacheEntry{key: k, value: v, expires: time.Now().Add(ttl)}
+
+	if el, ok := m.items[k]; ok {
+		el.Value = entry
+		m.ll.MoveToFront(el)
+		return nil
+	}
+
+	m.items[k] = m.ll.PushFront(entry)
+	if m.ll.Len() > m.size {
+		m.evictOldest()
+	}
+	return nil
+}
+
+func (m *MemoryCache) Get(k string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[k]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+
+	entry := el.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expires) {
+		m.ll.Remove(el)
+		delete(m.items, k)
+		return nil, ErrCacheMiss
+	}
+
+	m.ll.MoveToFront(el)
+	return entry.value, nil
+}
+
+func (m *MemoryCache) evictOldest() {
+	el := m.ll.Back()
+	if el == nil {
+		return
+	}
+	m.ll.Remove(el)
+	delete(m.items, el.Value.(*memoryCacheEntry).key)
+}
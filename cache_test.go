@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryCachePutGet(t *testing.T) {
+	c, err := newMemoryCache("memory://")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Put("a", []byte("1"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := c.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "1" {
+		t.Errorf("got %q, want %q", v, "1")
+	}
+}
+
+func TestMemoryCacheMiss(t *testing.T) {
+	c, err := newMemoryCache("memory://")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get("missing"); err != ErrCacheMiss {
+		t.Errorf("got %v, want ErrCacheMiss", err)
+	}
+}
+
+func TestMemoryCacheExpires(t *testing.T) {
+	c, err := newMemoryCache("memory://")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Put("a", []byte("1"), -time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get("a"); err != ErrCacheMiss {
+		t.Errorf("got %v, want ErrCacheMiss for expired entry", err)
+	}
+}
+
+func TestMemoryCacheEvictsOldest(t *testing.T) {
+	c, err := newMemoryCache("memory://?size=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Put("a", []byte("1"), time.Minute)
+	c.Put("b", []byte("2"), time.Minute)
+	c.Put("c", []byte("3"), time.Minute)
+
+	if _, err := c.Get("a"); err != ErrCacheMiss {
+		t.Errorf("expected oldest entry to be evicted, got err=%v", err)
+	}
+	if _, err := c.Get("c"); err != nil {
+		t.Errorf("expected newest entry to still be present, got err=%v", err)
+	}
+}
+
+func TestNewCacheRejectsMixedSchemes(t *testing.T) {
+	_, err := newCache([]string{"memcache://localhost:11211", "redis://localhost:6379/0"})
+	if err == nil {
+		t.Error("expected an error for mixed --cache schemes")
+	}
+}
+
+func TestNewCacheUnrecognisedScheme(t *testing.T) {
+	_, err := newCache([]string{"ftp://localhost"})
+	if err == nil {
+		t.Error("expected an error for an unrecognised --cache scheme")
+	}
+}
+
+func TestNewCacheRejectsMultipleRedisURLs(t *testing.T) {
+	_, err := newCache([]string{"redis://localhost:6379/0", "redis://localhost:6380/0"})
+	if err == nil {
+		t.Error("expected an error for more than one redis:// --cache URL")
+	}
+}
+
+func TestNewCacheRejectsMultipleMemoryURLs(t *testing.T) {
+	_, err := newCache([]string{"memory://?size=10", "memory://?size=20"})
+	if err == nil {
+		t.Error("expected an error for more than one memory:// --cache URL")
+	}
+}
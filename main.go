@@ -2,17 +2,21 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"regexp"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/buildkite/go-buildkite/buildkite"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -20,22 +24,28 @@ import (
 )
 
 var (
-	apiToken       = kingpin.Flag("buildkite-token", "Buildkite API token. Requires `read_builds` permissions.").Required().String()
-	org            = kingpin.Flag("buildkite-org", "Buildkite organization which is to be scraped.").Required().String()
-	port           = kingpin.Flag("port", "TCP port which the HTTP server should listen on.").Default("8080").Int()
-	memcachedAddrs = kingpin.Flag("memcache", "Memcache broker addresses (eg. 127.0.0.1:11211).").Strings()
-
-	serveCmd      = kingpin.Command("serve", "serve the the web app.")
-	reports       = serveCmd.Flag("report", `Report. Example: {"name": "Slow master builds", "from": "started", "to": "finished", "pipelines": ".*", "branches: "master", "group": "{{.Pipeline}}"} where 1) 'from'/'to' must be created, scheduled, started or finished, 2) 'pipelines'/'branches' is a regexp of what we are interested in, 3) name can be anything human readable, 4) 'group' is how all builds are grouped (a Golang template from Build).`).Required().Strings()
-	scrapeHistory = serveCmd.Flag("scrape-history", "How far back in time we scrape builds. Defaults to 28 days.").Default("672h").Duration()
+	apiToken  = kingpin.Flag("buildkite-token", "Buildkite API token. Requires `read_builds` permissions.").Required().String()
+	org       = kingpin.Flag("buildkite-org", "Buildkite organization which is to be scraped.").Required().String()
+	port      = kingpin.Flag("port", "TCP port which the HTTP server should listen on.").Default("8080").Int()
+	cacheURLs = kingpin.Flag("cache", "Cache backend URL(s). One of memcache://host:port (repeatable), redis://host:port/db or memory://?size=N.").Required().Strings()
+
+	serveCmd        = kingpin.Command("serve", "serve the the web app.")
+	reports         = serveCmd.Flag("report", `Report. Example: {"name": "Slow master builds", "from": "started", "to": "finished", "pipelines": ".*", "branches: "master", "group": "{{.Pipeline}}"} where 1) 'from'/'to' must be created, scheduled, started or finished, 2) 'pipelines'/'branches' is a regexp of what we are interested in, 3) name can be anything human readable, 4) 'group' is how all builds are grouped (a Golang template from Build).`).Strings()
+	reportsFile     = serveCmd.Flag("reports-file", "Path to a JSON file containing an array of report definitions (see --report). Watched for changes and hot-reloaded without a restart; takes precedence over --report once it has loaded successfully.").ExistingFile()
+	scrapeHistory   = serveCmd.Flag("scrape-history", "How far back in time we scrape builds. Defaults to 28 days.").Default("672h").Duration()
+	shutdownTimeout = serveCmd.Flag("shutdown-timeout", "How long to wait for in-flight requests and scrapes to finish on SIGINT/SIGTERM before forcing a shutdown.").Default("30s").Duration()
+	refreshInterval = serveCmd.Flag("refresh-interval", "If set, periodically refreshes the cache in the background (using --refresh-history as the window) instead of relying on a separate `refresh` cron.").Duration()
 
 	refreshCmd     = kingpin.Command("refresh", "rewrite recent data to cache. recommended to do in background regularly if you have a lot of builds.")
-	refreshHistory = refreshCmd.Flag("refresh-history", "How far back in time we update the cache.").Default("3h").Duration()
+	refreshHistory = kingpin.Flag("refresh-history", "How far back in time we update the cache.").Default("3h").Duration()
 )
 
 func main() {
 	cmd := kingpin.Parse()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	//buildkite.SetHttpDebug(true) // Useful when debugging.
 	config, err := buildkite.NewTokenConfig(optionalFileExpansion(*apiToken), false)
 
@@ -43,9 +53,10 @@ func main() {
 		log.Fatal("Incorrect token:", err)
 	}
 
-	cache := &MemcacheCache{memcache.New(*memcachedAddrs...)}
-
-	queries := mustBuildQueries(*reports)
+	cache, err := newCache(*cacheURLs)
+	if err != nil {
+		log.Fatal("Unable to build cache:", err)
+	}
 
 	client := buildkite.NewClient(config.Client())
 	client.UserAgent = "tink-buildkite-stats/v1.0.0"
@@ -57,62 +68,93 @@ func main() {
 
 	switch cmd {
 	case "serve":
-		serve(bk, queries)
+		store := newQueryStore(mustBuildQueries(*reports))
+		if *reportsFile != "" {
+			if err := watchReportsFile(*reportsFile, store); err != nil {
+				log.Fatal("Unable to load --reports-file:", err)
+			}
+		}
+		serve(ctx, bk, store)
 	case "refresh":
-		refresh(bk)
+		refresh(ctx, bk)
 	}
 }
 
-func serve(bk *NetworkBuildkite, queries []Query) {
+// atomicHandler lets the route tree Routes builds from the current report
+// queries be swapped out whenever queryStore changes, instead of being
+// rebuilt from scratch on every request.
+type atomicHandler struct {
+	v atomic.Value
+}
+
+func (h *atomicHandler) set(handler http.Handler) {
+	h.v.Store(handler)
+}
+
+func (h *atomicHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.v.Load().(http.Handler).ServeHTTP(w, r)
+}
+
+func serve(ctx context.Context, bk *NetworkBuildkite, store *queryStore) {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.DefaultLogger)
-	r.Mount("/", (&Routes{bk, queries, *scrapeHistory}).Routes())
+	routes := &atomicHandler{}
+	store.OnChange(func(queries []Query) {
+		routes.set((&Routes{bk, queries, *scrapeHistory}).Routes())
+	})
+	r.Mount("/", routes)
+	r.Mount("/metrics", newBuildMetrics(bk, store, *scrapeHistory))
+	r.Mount("/api/v1/reports", newReportAPI(bk, store, *scrapeHistory).Routes())
+
+	refresher := newBackgroundRefresher(bk, *refreshHistory)
+	r.Mount("/healthz", refresher)
+	if *refreshInterval > 0 {
+		go refresher.run(ctx, *refreshInterval)
+	}
 
+	pprofServer := &http.Server{Addr: "localhost:6060"}
 	go func() {
 		// pprof registers on default mux so starting it on a separate port.
 		// pprof is being imported an anonymous import in the web package.
-		log.Println(http.ListenAndServe("localhost:6060", nil))
+		if err := pprofServer.ListenAndServe(); err != http.ErrServerClosed {
+			log.Println(err)
+		}
+	}()
+
+	server := &http.Server{Addr: fmt.Sprintf(":%d", *port), Handler: r}
+
+	go func() {
+		<-ctx.Done()
+		log.Println("Shutting down...")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("HTTP server shutdown error: %v", err)
+		}
+		if err := pprofServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("pprof server shutdown error: %v", err)
+		}
 	}()
 
 	log.Printf("Listening on port %d", *port)
-	server := http.Server{Addr: fmt.Sprintf(":%d", *port), Handler: r}
 	if err := server.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatalf("HTTP server error: %v", err)
 	}
 }
 
-func refresh(bk *NetworkBuildkite) {
+func refresh(ctx context.Context, bk *NetworkBuildkite) {
 	from := time.Now().Add(-*refreshHistory)
 	log.Printf("Starting refresh between [%s, now)\n", from)
-	if err := bk.RefreshCache(from); err != nil {
+	if err := bk.RefreshCache(ctx, from); err != nil {
 		log.Fatalln(err)
 	}
 	log.Println("Refresh finished succesfully.")
 }
 
-type MemcacheCache struct {
-	c *memcache.Client
-}
-
-func (m *MemcacheCache) Put(k string, v []byte, ttl time.Duration) error {
-	return m.c.Set(&memcache.Item{
-		Key:        k,
-		Value:      v,
-		Expiration: int32(time.Now().Add(ttl).Unix()),
-	})
-}
-
-func (m *MemcacheCache) Get(k string) ([]byte, error) {
-	var res []byte
-	item, err := m.c.Get(k)
-	if err == nil {
-		res = item.Value
-	}
-	return res, err
-}
-
 func mustBuildQueries(queries []string) (res []Query) {
 	for _, q := range queries {
 		res = append(res, mustBuildQuery(q))
@@ -126,14 +168,47 @@ func mustBuildQuery(query string) Query {
 		log.Fatalln("unable to parse report:", err)
 	}
 
+	q, err := buildQuery(raw)
+	if err != nil {
+		log.Fatalln("unable to parse report:", err)
+	}
+	return q
+}
+
+func buildQuery(raw JSONQuery) (Query, error) {
+	from, err := parseQueryTimestamp(raw.From)
+	if err != nil {
+		return Query{}, err
+	}
+
+	to, err := parseQueryTimestamp(raw.To)
+	if err != nil {
+		return Query{}, err
+	}
+
+	pipelines, err := regexp.Compile(raw.Pipelines)
+	if err != nil {
+		return Query{}, err
+	}
+
+	branches, err := regexp.Compile(raw.Branches)
+	if err != nil {
+		return Query{}, err
+	}
+
+	group, err := template.New("group").Parse(raw.Group)
+	if err != nil {
+		return Query{}, err
+	}
+
 	return Query{
 		Name:      raw.Name,
-		from:      mustParseQueryTimestamp(raw.From),
-		to:        mustParseQueryTimestamp(raw.To),
-		pipelines: regexp.MustCompile(raw.Pipelines),
-		branches:  regexp.MustCompile(raw.Branches),
-		group:     template.Must(template.New("group").Parse(raw.Group)),
-	}
+		from:      from,
+		to:        to,
+		pipelines: pipelines,
+		branches:  branches,
+		group:     group,
+	}, nil
 }
 
 type JSONQuery struct {
@@ -179,22 +254,19 @@ const (
 	FinishedTimestamp
 )
 
-func mustParseQueryTimestamp(s string) QueryTimestamp {
+func parseQueryTimestamp(s string) (QueryTimestamp, error) {
 	switch s {
 	case "created":
-		return CreatedTimestamp
+		return CreatedTimestamp, nil
 	case "scheduled":
-		return ScheduledTimestamp
+		return ScheduledTimestamp, nil
 	case "started":
-		return StartedTimestamp
+		return StartedTimestamp, nil
 	case "finished":
-		return FinishedTimestamp
+		return FinishedTimestamp, nil
 	default:
-		log.Fatalln("unable to parse timestamp")
+		return 0, fmt.Errorf("unable to parse timestamp %q", s)
 	}
-
-	// will never happen
-	return 0
 }
 
 func (t QueryTimestamp) Extract(b Build) time.Time {
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// buildMetrics exports the same per-query, per-group data as the HTML
+// views. buildDurationSeconds and lastScrapeTimestamp describe the current
+// scrape window and are rebuilt fresh on every request, since a concurrent
+// Reset()-then-repopulate on a shared vector would corrupt whichever
+// scrape reads it mid-update. buildsTotal is the counter the request asked
+// for ("counters for passed/failed/canceled builds"): it's held for the
+// life of the process and only Inc'd once per build ID per scrape window,
+// so it behaves like an actual Prometheus counter instead of a relabelled
+// gauge.
+type buildMetrics struct {
+	builds  func(context.Context, time.Time) ([]Build, error)
+	store   *queryStore
+	history time.Duration
+
+	buildsTotal *prometheus.CounterVec
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+func newBuildMetrics(bk *NetworkBuildkite, store *queryStore, history time.Duration) *buildMetrics {
+	return &buildMetrics{
+		builds:  bk.Builds,
+		store:   store,
+		history: history,
+		buildsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "buildkite_builds_total",
+			Help: "Cumulative number of passed/failed/canceled builds observed, labeled by report, group and state.",
+		}, []string{"report", "group", "state"}),
+		seen: make(map[string]struct{}),
+	}
+}
+
+func (m *buildMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	builds, err := m.builds(r.Context(), time.Now().Add(-m.history))
+	if err != nil {
+		http.Error(w, "unable to load builds: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	buildDurationSeconds := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "buildkite_build_duration_seconds",
+		Help:    "Build duration in seconds, labeled by report and group.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"report", "group"})
+
+	lastScrapeTimestamp := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "buildkite_last_scrape_timestamp_seconds",
+		Help: "Unix timestamp of the last /metrics scrape.",
+	})
+
+	m.observeBuilds(builds, buildDurationSeconds)
+
+	lastScrapeTimestamp.SetToCurrentTime()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(buildDurationSeconds, m.buildsTotal, lastScrapeTimestamp)
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// observeBuilds records this scrape's durations into duration (a
+// request-local vector) and increments m.buildsTotal for any
+// passed/failed/canceled build not already counted in the previous scrape.
+// The dedup set is replaced rather than merged on every call, so it stays
+// bounded to roughly one scrape window's worth of builds instead of
+// growing for the life of the process.
+func (m *buildMetrics) observeBuilds(builds []Build, duration *prometheus.HistogramVec) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := make(map[string]struct{}, len(m.seen))
+
+	for _, q := range m.store.Get() {
+		for _, b := range builds {
+			if !q.Predicate(b) {
+				continue
+			}
+			group := q.Group(b)
+			duration.WithLabelValues(q.Name, group).Observe(q.Duration(b).Seconds())
+
+			switch b.State {
+			case "passed", "failed", "canceled":
+				key := q.Name + "\x00" + group + "\x00" + b.State + "\x00" + b.ID
+				seen[key] = struct{}{}
+				if _, alreadyCounted := m.seen[key]; !alreadyCounted {
+					m.buildsTotal.WithLabelValues(q.Name, group, b.State).Inc()
+				}
+			}
+		}
+	}
+
+	m.seen = seen
+}
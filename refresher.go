@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// backgroundRefresher periodically calls a refresh function so `serve` can
+// keep its own cache warm without an external cron/CronJob.
+type backgroundRefresher struct {
+	refresh func(ctx context.Context, from time.Time) error
+	history time.Duration
+	group   singleflight.Group
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastErr     error
+}
+
+func newBackgroundRefresher(bk *NetworkBuildkite, history time.Duration) *backgroundRefresher {
+	return &backgroundRefresher{refresh: bk.RefreshCache, history: history}
+}
+
+// run refreshes the cache every interval, jittered by up to 10%, until ctx
+// is cancelled.
+func (b *backgroundRefresher) run(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(jitteredInterval(interval)):
+			b.refreshOnce(ctx)
+		}
+	}
+}
+
+// jitteredInterval returns interval shifted by up to +/-10%, so that
+// multiple serve instances refreshing on the same interval don't all hit
+// the Buildkite API in lockstep.
+func jitteredInterval(interval time.Duration) time.Duration {
+	spread := interval / 5
+	if spread <= 0 {
+		return interval
+	}
+	jitter := time.Duration(rand.Int63n(int64(spread)))
+	return interval - interval/10 + jitter
+}
+
+// refreshOnce runs a single refresh, collapsing overlapping calls onto one
+// in-flight request via singleflight so a slow Buildkite API doesn't cause
+// concurrent refreshes to pile up.
+func (b *backgroundRefresher) refreshOnce(ctx context.Context) {
+	_, err, _ := b.group.Do("refresh", func() (interface{}, error) {
+		from := time.Now().Add(-b.history)
+		return nil, b.refresh(ctx, from)
+	})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err != nil {
+		log.Printf("background refresh failed: %v", err)
+		b.lastErr = err
+		return
+	}
+	b.lastSuccess = time.Now()
+	b.lastErr = nil
+}
+
+// healthzResponse reports the background refresher's status. Both fields
+// use a pointer/empty-string zero value respectively, since encoding/json's
+// omitempty does not treat a zero-value struct (such as a never-set
+// time.Time) as empty.
+type healthzResponse struct {
+	LastRefreshSuccess *time.Time `json:"last_refresh_success,omitempty"`
+	LastRefreshError   string     `json:"last_refresh_error,omitempty"`
+}
+
+func (b *backgroundRefresher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	var resp healthzResponse
+	if !b.lastSuccess.IsZero() {
+		lastSuccess := b.lastSuccess
+		resp.LastRefreshSuccess = &lastSuccess
+	}
+	if b.lastErr != nil {
+		resp.LastRefreshError = b.lastErr.Error()
+	}
+	b.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
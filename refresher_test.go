@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJitteredIntervalBounds(t *testing.T) {
+	interval := time.Minute
+	lo := interval - interval/10
+	hi := lo + interval/5
+
+	for i := 0; i < 100; i++ {
+		got := jitteredInterval(interval)
+		if got < lo || got >= hi {
+			t.Fatalf("jitteredInterval(%v) = %v, want in [%v, %v)", interval, got, lo, hi)
+		}
+	}
+}
+
+func TestJitteredIntervalTinyInterval(t *testing.T) {
+	// interval/5 == 0 must not panic rand.Int63n.
+	if got := jitteredInterval(time.Nanosecond); got < 0 {
+		t.Fatalf("jitteredInterval(1ns) = %v, want >= 0", got)
+	}
+}
+
+func TestRefreshOnceSuccess(t *testing.T) {
+	b := &backgroundRefresher{
+		refresh: func(ctx context.Context, from time.Time) error { return nil },
+	}
+
+	b.refreshOnce(context.Background())
+
+	if b.lastSuccess.IsZero() {
+		t.Error("expected lastSuccess to be set after a successful refresh")
+	}
+	if b.lastErr != nil {
+		t.Errorf("expected lastErr to be nil, got %v", b.lastErr)
+	}
+}
+
+func TestRefreshOnceError(t *testing.T) {
+	wantErr := errors.New("boom")
+	b := &backgroundRefresher{
+		refresh: func(ctx context.Context, from time.Time) error { return wantErr },
+	}
+
+	b.refreshOnce(context.Background())
+
+	if b.lastErr != wantErr {
+		t.Errorf("lastErr = %v, want %v", b.lastErr, wantErr)
+	}
+	if !b.lastSuccess.IsZero() {
+		t.Error("expected lastSuccess to stay zero after a failed refresh")
+	}
+}
+
+func TestRefreshOnceCollapsesOverlappingCalls(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+
+	b := &backgroundRefresher{
+		refresh: func(ctx context.Context, from time.Time) error {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return nil
+		},
+	}
+
+	ready := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		close(ready)
+		b.refreshOnce(context.Background())
+	}()
+	<-ready
+	go func() {
+		defer wg.Done()
+		b.refreshOnce(context.Background())
+	}()
+
+	time.Sleep(20 * time.Millisecond) // give both calls a chance to join the singleflight group
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("refresh invoked %d times for two overlapping refreshOnce calls, want 1", got)
+	}
+}
+
+func TestHealthzServeHTTPZeroValue(t *testing.T) {
+	b := &backgroundRefresher{}
+
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	if _, ok := raw["last_refresh_success"]; ok {
+		t.Errorf("expected last_refresh_success to be omitted before any refresh, got %v", raw)
+	}
+	if _, ok := raw["last_refresh_error"]; ok {
+		t.Errorf("expected last_refresh_error to be omitted before any refresh, got %v", raw)
+	}
+}
+
+func TestHealthzServeHTTPAfterSuccessThenError(t *testing.T) {
+	b := &backgroundRefresher{
+		refresh: func(ctx context.Context, from time.Time) error { return nil },
+	}
+	b.refreshOnce(context.Background()) // refresh func returns nil -> success
+
+	wantErr := errors.New("buildkite: 503")
+	b.refresh = func(ctx context.Context, from time.Time) error { return wantErr }
+	b.refreshOnce(context.Background())
+
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	var resp healthzResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	if resp.LastRefreshSuccess == nil {
+		t.Error("expected last_refresh_success to still reflect the earlier successful refresh")
+	}
+	if resp.LastRefreshError != wantErr.Error() {
+		t.Errorf("last_refresh_error = %q, want %q", resp.LastRefreshError, wantErr.Error())
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// queryStore holds the currently active set of report queries, so they can
+// be swapped atomically when --reports-file changes on disk.
+type queryStore struct {
+	mu       sync.RWMutex
+	queries  []Query
+	onChange func([]Query)
+}
+
+func newQueryStore(queries []Query) *queryStore {
+	return &queryStore{queries: queries}
+}
+
+func (s *queryStore) Get() []Query {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.queries
+}
+
+// OnChange registers f to be called with the current queries immediately,
+// and again every time set replaces them. Only one callback is supported;
+// it's meant for a single subscriber (serve's route tree) to rebuild
+// whatever it derives from the query set, rather than recomputing that on
+// every request.
+func (s *queryStore) OnChange(f func([]Query)) {
+	s.mu.Lock()
+	s.onChange = f
+	queries := s.queries
+	s.mu.Unlock()
+
+	f(queries)
+}
+
+func (s *queryStore) set(queries []Query) {
+	s.mu.Lock()
+	s.queries = queries
+	onChange := s.onChange
+	s.mu.Unlock()
+
+	if onChange != nil {
+		onChange(queries)
+	}
+}
+
+// watchReportsFile parses path into store immediately, then watches it for
+// changes and re-parses whenever it does. A parse error is logged and
+// leaves the currently-serving queries untouched.
+//
+// Kubernetes ConfigMap mounts update by atomically repointing a symlink in
+// the file's directory, which fires Remove/Rename on path rather than
+// Write, and leaves path unwatchable afterwards if we'd added it directly.
+// So we watch the parent directory instead and filter events by basename,
+// which sees the symlink swap regardless of which op it shows up as.
+func watchReportsFile(path string, store *queryStore) error {
+	queries, err := parseReportsFile(path)
+	if err != nil {
+		return err
+	}
+	store.set(queries)
+
+	dir := filepath.Dir(path)
+	base := filepath.Base(path)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		for event := range watcher.Events {
+			if filepath.Base(event.Name) != base {
+				continue
+			}
+
+			queries, err := parseReportsFile(path)
+			if err != nil {
+				log.Printf("reports-file: keeping previous reports, failed to parse %s: %v", path, err)
+				continue
+			}
+
+			store.set(queries)
+			log.Printf("reports-file: reloaded %d report(s) from %s", len(queries), path)
+		}
+	}()
+
+	return nil
+}
+
+func parseReportsFile(path string) ([]Query, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []JSONQuery
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+
+	queries := make([]Query, 0, len(raw))
+	for _, r := range raw {
+		q, err := buildQuery(r)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	return queries, nil
+}
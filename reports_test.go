@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const validReportsJSON = `[
+	{"name": "slow master", "from": "started", "to": "finished", "pipelines": ".*", "branches": "master", "group": "{{.Pipeline.Name}}"}
+]`
+
+func TestParseReportsFileValid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "reports.json")
+	if err := os.WriteFile(path, []byte(validReportsJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	queries, err := parseReportsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 {
+		t.Fatalf("got %d queries, want 1", len(queries))
+	}
+	if queries[0].Name != "slow master" {
+		t.Errorf("Name = %q, want %q", queries[0].Name, "slow master")
+	}
+}
+
+func TestParseReportsFileMalformedJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "reports.json")
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parseReportsFile(path); err == nil {
+		t.Error("expected an error for malformed JSON")
+	}
+}
+
+func TestParseReportsFileBadRegexp(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "reports.json")
+	content := `[{"name": "x", "from": "created", "to": "finished", "pipelines": "(", "branches": ".*", "group": "g"}]`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parseReportsFile(path); err == nil {
+		t.Error("expected an error for an invalid pipelines regexp")
+	}
+}
+
+func TestParseReportsFileBadTimestamp(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "reports.json")
+	content := `[{"name": "x", "from": "yesterday", "to": "finished", "pipelines": ".*", "branches": ".*", "group": "g"}]`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parseReportsFile(path); err == nil {
+		t.Error("expected an error for an unrecognised from/to timestamp")
+	}
+}
+
+func TestParseReportsFileMissing(t *testing.T) {
+	if _, err := parseReportsFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestWatchReportsFileLoadsInitialContent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "reports.json")
+	if err := os.WriteFile(path, []byte(validReportsJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := newQueryStore(nil)
+	if err := watchReportsFile(path, store); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := store.Get(); len(got) != 1 || got[0].Name != "slow master" {
+		t.Fatalf("store.Get() = %+v, want the one report from %s", got, path)
+	}
+}
+
+func TestWatchReportsFileReloadsOnWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "reports.json")
+	if err := os.WriteFile(path, []byte(validReportsJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := newQueryStore(nil)
+	if err := watchReportsFile(path, store); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := `[{"name": "a", "from": "created", "to": "finished", "pipelines": ".*", "branches": ".*", "group": "g"}, {"name": "b", "from": "created", "to": "finished", "pipelines": ".*", "branches": ".*", "group": "g"}]`
+	if err := os.WriteFile(path, []byte(updated), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(store.Get()) == 2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("store was not reloaded within the deadline, still has %d queries", len(store.Get()))
+}
+
+func TestWatchReportsFileKeepsPreviousQueriesOnParseError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "reports.json")
+	if err := os.WriteFile(path, []byte(validReportsJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := newQueryStore(nil)
+	if err := watchReportsFile(path, store); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// There's nothing to poll for on success (the store should stay
+	// exactly as it was), so give the watcher goroutine a beat to
+	// (wrongly) apply the bad parse before asserting it didn't.
+	time.Sleep(200 * time.Millisecond)
+
+	if got := store.Get(); len(got) != 1 || got[0].Name != "slow master" {
+		t.Fatalf("store.Get() = %+v, want the previous valid report to be kept", got)
+	}
+}